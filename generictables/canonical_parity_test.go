@@ -0,0 +1,53 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generictables_test
+
+import (
+	"testing"
+
+	"github.com/projectcalico/felix/generictables"
+	"github.com/projectcalico/felix/iptables"
+	"github.com/projectcalico/felix/nftables"
+)
+
+// TestCanonicalFragmentParity guards against the two backends' CanonicalAction
+// implementations drifting apart: if they disagree, Chain.RuleHashes gives
+// the same rule a different hash under each backend, so a Backend switch
+// churns every rule using that action - the exact churn backend-stable
+// hashing exists to prevent.
+func TestCanonicalFragmentParity(t *testing.T) {
+	cases := []struct {
+		name     string
+		iptables generictables.CanonicalAction
+		nftables generictables.CanonicalAction
+	}{
+		{"accept", iptables.AcceptAction{}, nftables.AcceptAction{}},
+		{"drop", iptables.DropAction{}, nftables.DropAction{}},
+		{"return", iptables.ReturnAction{}, nftables.ReturnAction{}},
+		{"jump", iptables.JumpAction{ChainName: "cali-FORWARD"}, nftables.JumpAction{ChainName: "cali-FORWARD"}},
+		{"mark", iptables.MarkAction{Mark: 0x1000, Mask: 0xf000}, nftables.MarkAction{Mark: 0x1000, Mask: 0xf000}},
+		{"snat", iptables.SNATAction{ToAddr: "10.0.0.1", OutInterface: "eth0"}, nftables.SNATAction{ToAddr: "10.0.0.1", OutInterface: "eth0"}},
+		{"ct-zone", iptables.CTZoneAction{Zone: 5}, nftables.CTZoneAction{Zone: 5}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.nftables.CanonicalFragment()
+			want := c.iptables.CanonicalFragment()
+			if got != want {
+				t.Errorf("nftables CanonicalFragment() = %q, want %q (iptables)", got, want)
+			}
+		})
+	}
+}
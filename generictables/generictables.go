@@ -0,0 +1,99 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generictables holds the pieces of the rule-rendering model that are
+// common to more than one dataplane backend (iptables, nftables, ...).  It
+// lets the iptables and nftables packages share expression-building logic
+// and lets callers (such as the table manager) work with rules without
+// caring which backend will ultimately render them.
+package generictables
+
+import "strings"
+
+// Backend identifies which underlying tool a Chain/Rule should be rendered
+// for.  It's a value type only at this point: no Table/Dataplane type exists
+// yet to read it and pick a renderer/applier at runtime, and applying an
+// nftables.Chain today still means shelling out to the nft CLI, not talking
+// netlink directly.  Wiring Backend into an actual selection point, and
+// replacing the iptables-restore/nft-CLI shell-outs with a netlink-based
+// apply path, is follow-up work for the table/dataplane manager, not
+// something this renderer-only package does itself.
+type Backend string
+
+const (
+	BackendIPTables Backend = "iptables"
+	BackendNFTables Backend = "nftables"
+)
+
+// MatchCriteria is the common interface satisfied by both iptables.MatchCriteria
+// and nftables.MatchCriteria.  It lets shared code (for example hashing) work
+// with either backend's match representation without depending on either
+// package concretely.
+type MatchCriteria interface {
+	// Render returns the backend-specific fragment for this match, suitable
+	// for splicing directly into a rule line for that backend.
+	Render() string
+}
+
+// CanonicalMatchCriteria is an optional extension of MatchCriteria.  Backends
+// that can describe their match in a backend-independent way should
+// implement it so that Chain.RuleHashes (see both iptables and nftables
+// packages) produces the same hash for the "same" rule regardless of which
+// backend rendered it.  This avoids a full rule-hash churn (and hence a
+// churn of rule replacement) when an operator flips Backend on upgrade.
+//
+// Match builders that haven't been updated to implement this yet are still
+// usable; callers fall back to Render() for hashing in that case, at the
+// cost of losing backend-stability for that particular match.
+type CanonicalMatchCriteria interface {
+	MatchCriteria
+	// Canonical returns a backend-independent, deterministically-ordered
+	// token list describing what is being matched, e.g.
+	// []string{"ipset:src:my-ipset-id"}.
+	Canonical() []string
+}
+
+// CanonicalAction is the Action-side counterpart of CanonicalMatchCriteria.
+// Each backend's own Action interface keeps its own ToFragment signature
+// (its Features parameter differs per backend), so there is no shared
+// Action interface here; this is purely an optional extra an Action
+// implementation can provide.
+type CanonicalAction interface {
+	// CanonicalFragment returns a backend-independent fragment describing
+	// this action, used as hash input instead of the backend-rendered
+	// fragment so that Chain.RuleHashes is stable across backends.
+	CanonicalFragment() string
+}
+
+// CanonicalRuleHashInput builds the backend-stable hash input shared by
+// iptables.Chain.RuleHashes and nftables.Chain.RuleHashes: each rule's
+// comments, its match's canonical form (falling back to its rendered form
+// for matches that don't implement CanonicalMatchCriteria yet), and its
+// action's canonical fragment if action is non-nil, or renderedAction
+// otherwise.  Callers are responsible for the type assertion on their own
+// Action interface, since its ToFragment signature differs per backend.
+func CanonicalRuleHashInput(comment []string, match MatchCriteria, action CanonicalAction, renderedAction string) string {
+	fragments := append([]string(nil), comment...)
+	if cm, ok := match.(CanonicalMatchCriteria); ok {
+		fragments = append(fragments, cm.Canonical()...)
+	} else {
+		fragments = append(fragments, match.Render())
+	}
+	if action != nil {
+		fragments = append(fragments, action.CanonicalFragment())
+	} else {
+		fragments = append(fragments, renderedAction)
+	}
+	return strings.Join(fragments, "\x00")
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import "fmt"
+
+// The Action implementations below are deliberately the small common subset
+// (accept/drop/return/jump/mark/snat/ct-zone) rather than the full
+// policy-program action set (REJECT, DNAT, NFLOG, ...), which belongs to the dataplane
+// policy-program layer.  They exist so that CanonicalAction (used by
+// Chain.RuleHashes for backend-stable hashing) and the JSON/YAML codec
+// (RegisterAction) have real implementations to exercise instead of unused
+// extension points.
+
+func init() {
+	RegisterAction("accept", AcceptAction{})
+	RegisterAction("drop", DropAction{})
+	RegisterAction("return", ReturnAction{})
+	RegisterAction("jump", JumpAction{})
+	RegisterAction("mark", MarkAction{})
+	RegisterAction("snat", SNATAction{})
+	RegisterAction("ct-zone", CTZoneAction{})
+}
+
+// AcceptAction renders "-j ACCEPT".
+type AcceptAction struct{}
+
+func (a AcceptAction) ToFragment(features *Features) string { return "-j ACCEPT" }
+
+func (a AcceptAction) CanonicalFragment() string { return "accept" }
+
+// DropAction renders "-j DROP".
+type DropAction struct{}
+
+func (a DropAction) ToFragment(features *Features) string { return "-j DROP" }
+
+func (a DropAction) CanonicalFragment() string { return "drop" }
+
+// ReturnAction renders "-j RETURN".
+type ReturnAction struct{}
+
+func (a ReturnAction) ToFragment(features *Features) string { return "-j RETURN" }
+
+func (a ReturnAction) CanonicalFragment() string { return "return" }
+
+// JumpAction renders "-j <ChainName>".
+type JumpAction struct {
+	ChainName string `json:"chainName"`
+}
+
+func (a JumpAction) ToFragment(features *Features) string { return "-j " + a.ChainName }
+
+func (a JumpAction) CanonicalFragment() string { return "jump:" + a.ChainName }
+
+// AddReferences implements ReferenceAdder: a jump is a reference to its
+// target chain, so Chain.References can report it and the table manager
+// can catch a dangling target before iptables-restore does.
+func (a JumpAction) AddReferences(refs *References) {
+	refs.ChainNames[a.ChainName] = true
+}
+
+// MarkAction renders "-j MARK --set-xmark <mark>/<mask>".
+type MarkAction struct {
+	Mark uint32 `json:"mark"`
+	Mask uint32 `json:"mask"`
+}
+
+func (a MarkAction) ToFragment(features *Features) string {
+	return fmt.Sprintf("-j MARK --set-xmark 0x%x/0x%x", a.Mark, a.Mask)
+}
+
+func (a MarkAction) CanonicalFragment() string {
+	return fmt.Sprintf("mark:0x%x/0x%x", a.Mark, a.Mask)
+}
+
+// AddReferences implements ReferenceAdder, recording the fwmark value this
+// rule sets.
+func (a MarkAction) AddReferences(refs *References) {
+	refs.MarkValues[a.Mark] = true
+}
+
+// SNATAction renders "-j SNAT --to-source <ToAddr>" bound to an
+// out-interface, e.g. for masquerading traffic leaving a particular NIC.
+type SNATAction struct {
+	ToAddr       string `json:"toAddr"`
+	OutInterface string `json:"outInterface"`
+}
+
+func (a SNATAction) ToFragment(features *Features) string {
+	return fmt.Sprintf("-o %s -j SNAT --to-source %s", a.OutInterface, a.ToAddr)
+}
+
+func (a SNATAction) CanonicalFragment() string {
+	return fmt.Sprintf("snat:%s:%s", a.OutInterface, a.ToAddr)
+}
+
+// AddReferences implements ReferenceAdder, recording the out-interface this
+// rule is bound to.
+func (a SNATAction) AddReferences(refs *References) {
+	if a.OutInterface != "" {
+		refs.InterfaceNames[a.OutInterface] = true
+	}
+}
+
+// CTZoneAction renders "-j CT --zone <Zone>", assigning the connection to a
+// non-default conntrack zone.
+type CTZoneAction struct {
+	Zone uint16 `json:"zone"`
+}
+
+func (a CTZoneAction) ToFragment(features *Features) string {
+	return fmt.Sprintf("-j CT --zone %d", a.Zone)
+}
+
+func (a CTZoneAction) CanonicalFragment() string {
+	return fmt.Sprintf("ctzone:%d", a.Zone)
+}
+
+// AddReferences implements ReferenceAdder, recording the conntrack zone
+// this rule assigns.
+func (a CTZoneAction) AddReferences(refs *References) {
+	refs.ConntrackZones[a.Zone] = true
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Chain and MatchCriteria round-trip through encoding/json and gopkg.in/yaml.v2
+// using their default struct/slice encodings; nothing in this file needs to
+// special-case them.  Action is the exception: it's an interface, so we need
+// a small registry (in the same spirit as encoding/gob's Register) mapping a
+// stable type name to the concrete Go type, plus an envelope that carries
+// that name alongside the encoded action so Rule can be decoded back into
+// the right concrete type.
+
+var (
+	actionRegistryMu sync.RWMutex
+	actionRegistry   = map[string]reflect.Type{}
+)
+
+// RegisterAction records the concrete type behind an Action implementation
+// under name, so that Rule's JSON/YAML codec can reconstruct it later.
+// Concrete Action types should call this from an init() function, the same
+// way encoding/gob consumers call gob.Register.  name must be unique and
+// stable across releases: it's what ends up on disk/in transit.
+func RegisterAction(name string, action Action) {
+	t := reflect.TypeOf(action)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	actionRegistryMu.Lock()
+	defer actionRegistryMu.Unlock()
+	actionRegistry[name] = t
+}
+
+// actionEnvelope is the on-the-wire JSON shape for an Action: its registered
+// type name plus its own JSON encoding.
+type actionEnvelope struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func actionTypeName(a Action) (string, error) {
+	t := reflect.TypeOf(a)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	actionRegistryMu.RLock()
+	defer actionRegistryMu.RUnlock()
+	for name, rt := range actionRegistry {
+		if rt == t {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("action type %v is not registered; call RegisterAction in its init()", t)
+}
+
+func marshalAction(a Action) (json.RawMessage, error) {
+	if a == nil {
+		return json.Marshal(nil)
+	}
+	name, err := actionTypeName(a)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling action %T: %w", a, err)
+	}
+	return json.Marshal(actionEnvelope{Type: name, Data: data})
+}
+
+func unmarshalActionByName(typeName string, data json.RawMessage) (Action, error) {
+	actionRegistryMu.RLock()
+	t, ok := actionRegistry[typeName]
+	actionRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown action type %q; is it registered with RegisterAction?", typeName)
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("unmarshaling action data for type %q: %w", typeName, err)
+	}
+	// RegisterAction records the non-pointer type, so reconstruct the same
+	// shape here; reflect.New always gives us a *T to unmarshal into.
+	action, ok := v.Elem().Interface().(Action)
+	if !ok {
+		return nil, fmt.Errorf("registered type %q does not implement Action", typeName)
+	}
+	return action, nil
+}
+
+func unmarshalAction(data json.RawMessage) (Action, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var env actionEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	return unmarshalActionByName(env.Type, env.Data)
+}
+
+type jsonRule struct {
+	Match   MatchCriteria   `json:"match,omitempty"`
+	Action  json.RawMessage `json:"action,omitempty"`
+	Comment []string        `json:"comment,omitempty"`
+}
+
+func (r Rule) MarshalJSON() ([]byte, error) {
+	actionJSON, err := marshalAction(r.Action)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonRule{Match: r.Match, Action: actionJSON, Comment: r.Comment})
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var jr jsonRule
+	if err := json.Unmarshal(data, &jr); err != nil {
+		return err
+	}
+	action, err := unmarshalAction(jr.Action)
+	if err != nil {
+		return err
+	}
+	r.Match = jr.Match
+	r.Action = action
+	r.Comment = jr.Comment
+	return nil
+}
+
+// yamlAction is the YAML counterpart of actionEnvelope.  We can't reuse
+// json.RawMessage here because yaml.v2 has no notion of "embed this other
+// codec's raw bytes verbatim"; Data is encoded from a plain
+// map[string]interface{} instead, and decodes as yaml.v2's
+// map[interface{}]interface{} (see UnmarshalYAML).
+type yamlAction struct {
+	Type string      `yaml:"type"`
+	Data interface{} `yaml:"data"`
+}
+
+type yamlRule struct {
+	Match   MatchCriteria `yaml:"match,omitempty"`
+	Action  yamlAction    `yaml:"action,omitempty"`
+	Comment []string      `yaml:"comment,omitempty"`
+}
+
+func (r Rule) MarshalYAML() (interface{}, error) {
+	if r.Action == nil {
+		return yamlRule{Match: r.Match, Comment: r.Comment}, nil
+	}
+	name, err := actionTypeName(r.Action)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(r.Action)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling action %T: %w", r.Action, err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return yamlRule{Match: r.Match, Action: yamlAction{Type: name, Data: generic}, Comment: r.Comment}, nil
+}
+
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var yr yamlRule
+	if err := unmarshal(&yr); err != nil {
+		return err
+	}
+	r.Match = yr.Match
+	r.Comment = yr.Comment
+	if yr.Action.Type == "" {
+		r.Action = nil
+		return nil
+	}
+	// yaml.v2 decodes a mapping into an interface{} field as
+	// map[interface{}]interface{}, not map[string]interface{}, which
+	// json.Marshal refuses to encode; normalize it first.
+	data, err := json.Marshal(jsonSafe(yr.Action.Data))
+	if err != nil {
+		return err
+	}
+	action, err := unmarshalActionByName(yr.Action.Type, data)
+	if err != nil {
+		return err
+	}
+	r.Action = action
+	return nil
+}
+
+// jsonSafe recursively rewrites a value decoded by yaml.v2 into something
+// encoding/json can marshal, converting every map[interface{}]interface{}
+// (and the maps/slices nested inside it) into map[string]interface{}.
+// yaml.v2 always decodes mappings this way when the destination is an
+// interface{}, so this is required for any interface{}-typed field that's
+// round-tripped through both encoders, not just yamlAction.Data.
+func jsonSafe(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = jsonSafe(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = jsonSafe(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
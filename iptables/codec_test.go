@@ -0,0 +1,91 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestRuleJSONRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "accept", rule: Rule{Match: MatchCriteria{"-p tcp"}, Action: AcceptAction{}, Comment: []string{"c1"}}},
+		{name: "drop", rule: Rule{Match: MatchCriteria{"-p udp"}, Action: DropAction{}}},
+		{name: "return", rule: Rule{Action: ReturnAction{}}},
+		{name: "jump", rule: Rule{Match: MatchCriteria{"-m set --match-set foo src"}, Action: JumpAction{ChainName: "cali-FORWARD"}}},
+		{name: "mark", rule: Rule{Action: MarkAction{Mark: 0x1000, Mask: 0xf000}}},
+		{name: "nil action", rule: Rule{Match: MatchCriteria{"-p tcp"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := json.Marshal(c.rule)
+			if err != nil {
+				t.Fatalf("MarshalJSON: %v", err)
+			}
+			var got Rule
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("UnmarshalJSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.rule) {
+				t.Errorf("round trip mismatch: got %#v, want %#v (json: %s)", got, c.rule, data)
+			}
+		})
+	}
+}
+
+// TestRuleYAMLRoundTrip drives the real gopkg.in/yaml.v2 encoder/decoder
+// rather than hand-feeding UnmarshalYAML's callback: yaml.v2 decodes a
+// mapping into an interface{} field as map[interface{}]interface{}, not
+// map[string]interface{}, which is a different shape than what this test
+// used to construct by hand and wouldn't have caught codec.go mishandling.
+func TestRuleYAMLRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "accept", rule: Rule{Match: MatchCriteria{"-p tcp"}, Action: AcceptAction{}, Comment: []string{"c1"}}},
+		{name: "jump", rule: Rule{Match: MatchCriteria{"-m set --match-set foo src"}, Action: JumpAction{ChainName: "cali-FORWARD"}}},
+		{name: "mark", rule: Rule{Action: MarkAction{Mark: 0x1000, Mask: 0xf000}}},
+		{name: "nil action", rule: Rule{Match: MatchCriteria{"-p tcp"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := yaml.Marshal(c.rule)
+			if err != nil {
+				t.Fatalf("yaml.Marshal: %v", err)
+			}
+			var got Rule
+			if err := yaml.Unmarshal(data, &got); err != nil {
+				t.Fatalf("yaml.Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.rule) {
+				t.Errorf("round trip mismatch: got %#v, want %#v (yaml: %s)", got, c.rule, data)
+			}
+		})
+	}
+}
+
+func TestUnmarshalActionByNameUnknownType(t *testing.T) {
+	_, err := unmarshalActionByName("not-a-real-action", json.RawMessage(`{}`))
+	if err == nil {
+		t.Fatal("expected an error for an unregistered action type")
+	}
+}
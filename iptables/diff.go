@@ -0,0 +1,126 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+// RuleChangeKind identifies the kind of edit a RuleChange describes.
+type RuleChangeKind string
+
+const (
+	RuleChangeInsert  RuleChangeKind = "insert"
+	RuleChangeDelete  RuleChangeKind = "delete"
+	RuleChangeReplace RuleChangeKind = "replace"
+)
+
+// RuleChange describes one edit needed to turn one Chain's rules into
+// another's, as returned by Chain.Diff.
+type RuleChange struct {
+	Kind RuleChangeKind
+	// Position is the rule's 0-based index: in the "from" chain for
+	// Delete, in the "to" chain for Insert and Replace.
+	Position int
+	// Hash is the rule hash (see RuleHashes) of the rule this change
+	// applies, i.e. the hash of Rule.
+	Hash string
+	// Rule is the new rule content for Insert/Replace, or the rule being
+	// removed for Delete.
+	Rule Rule
+}
+
+// Diff compares c (the chain as currently programmed) against other (the
+// chain as it should be) and returns the sequence of RuleChanges needed to
+// turn c into other.  Unchanged rules before the first differing rule and
+// after the last one are never reported as changed; an unchanged rule that
+// sits between two differing rules is reported as a Replace.  Either
+// receiver may be nil, which is treated as an empty chain.
+//
+// Unchanged rules are found by comparing each rule's own canonicalHashInput,
+// not its RuleHashes entry: RuleHashes deliberately chains each rule's hash
+// in with its predecessor's (see RuleHashes) so that a rule's hash reflects
+// its position in the chain, which means a genuinely-unchanged rule after an
+// earlier edit still gets a new RuleHashes value.  That chaining is exactly
+// what we don't want here, so Diff uses the unchained per-rule signature to
+// find the common prefix/suffix, and only consults RuleHashes to populate
+// each RuleChange's Hash field for the caller.
+//
+// This gives callers a supported way to answer "what would change if I
+// applied this policy?" - for example to build CI drift-detection - without
+// parsing Felix's internal debug logs.
+func (c *Chain) Diff(other *Chain, features *Features) []RuleChange {
+	if c == nil {
+		c = &Chain{}
+	}
+	if other == nil {
+		other = &Chain{}
+	}
+	fromHashes := c.RuleHashes(features)
+	toHashes := other.RuleHashes(features)
+
+	fromSigs := make([]string, len(c.Rules))
+	for i, rule := range c.Rules {
+		fromSigs[i] = canonicalHashInput(rule, features)
+	}
+	toSigs := make([]string, len(other.Rules))
+	for i, rule := range other.Rules {
+		toSigs[i] = canonicalHashInput(rule, features)
+	}
+
+	prefix := 0
+	for prefix < len(fromSigs) && prefix < len(toSigs) && fromSigs[prefix] == toSigs[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(fromSigs)-prefix && suffix < len(toSigs)-prefix &&
+		fromSigs[len(fromSigs)-1-suffix] == toSigs[len(toSigs)-1-suffix] {
+		suffix++
+	}
+
+	fromMid := fromHashes[prefix : len(fromHashes)-suffix]
+	toMid := toHashes[prefix : len(toHashes)-suffix]
+
+	common := len(fromMid)
+	if len(toMid) < common {
+		common = len(toMid)
+	}
+
+	var changes []RuleChange
+	for i := 0; i < common; i++ {
+		changes = append(changes, RuleChange{
+			Kind:     RuleChangeReplace,
+			Position: prefix + i,
+			Hash:     toMid[i],
+			Rule:     other.Rules[prefix+i],
+		})
+	}
+	// Delete from the back so that earlier Delete positions in this slice
+	// stay valid if the caller applies them against c.Rules in order.
+	for i := len(fromMid) - 1; i >= common; i-- {
+		changes = append(changes, RuleChange{
+			Kind:     RuleChangeDelete,
+			Position: prefix + i,
+			Hash:     fromMid[i],
+			Rule:     c.Rules[prefix+i],
+		})
+	}
+	for i := common; i < len(toMid); i++ {
+		changes = append(changes, RuleChange{
+			Kind:     RuleChangeInsert,
+			Position: prefix + i,
+			Hash:     toMid[i],
+			Rule:     other.Rules[prefix+i],
+		})
+	}
+	return changes
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import "strings"
+
+// Canonical implements generictables.CanonicalMatchCriteria.  Today it only
+// normalizes ipset matches ("-m set --match-set <id> <direction>") into the
+// backend-independent "ipset:<direction>:<id>" token also produced by
+// nftables.MatchCriteria.Canonical for the equivalent nft fragment, which is
+// what lets Chain.RuleHashes be stable across the two backends for an
+// ipset-based rule.  Any other match fragment is passed through prefixed
+// with "raw:", which keeps it distinguishable from a normalized token but
+// does NOT make it backend-stable - match types we haven't taught this to
+// normalize yet still tie the hash to iptables' own syntax.
+func (m MatchCriteria) Canonical() []string {
+	tokens := make([]string, 0, len(m))
+	for _, fragment := range []string(m) {
+		tokens = append(tokens, canonicalizeMatchFragment(fragment))
+	}
+	return tokens
+}
+
+func canonicalizeMatchFragment(fragment string) string {
+	words := strings.Split(fragment, " ")
+	if len(words) == 5 && words[0] == "-m" && words[1] == "set" && words[2] == "--match-set" {
+		return "ipset:" + words[4] + ":" + words[3]
+	}
+	return "raw:" + fragment
+}
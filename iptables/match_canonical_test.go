@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchCriteriaCanonical(t *testing.T) {
+	cases := []struct {
+		name  string
+		match MatchCriteria
+		want  []string
+	}{
+		{
+			name:  "ipset src",
+			match: MatchCriteria{"-m set --match-set foo src"},
+			want:  []string{"ipset:src:foo"},
+		},
+		{
+			name:  "ipset src,dst",
+			match: MatchCriteria{"-m set --match-set foo src,dst"},
+			want:  []string{"ipset:src,dst:foo"},
+		},
+		{
+			name:  "unrecognized fragment falls back to raw",
+			match: MatchCriteria{"-p tcp --dport 80"},
+			want:  []string{"raw:-p tcp --dport 80"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.match.Canonical()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Canonical() = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
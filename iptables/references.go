@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import "strings"
+
+// MatchDirection records which direction(s) a reference applies to, mirroring
+// the src/dst/src,dst flag that follows an ipset (or similar) match in
+// iptables syntax.
+type MatchDirection string
+
+const (
+	DirectionSource     MatchDirection = "src"
+	DirectionDest       MatchDirection = "dst"
+	DirectionSourceDest MatchDirection = "src,dst"
+)
+
+// References enumerates everything a Chain refers to elsewhere in the
+// dataplane state.  It replaces the old, ipset-only, best-effort IPSetIDs
+// scan so the table manager can build a precise dependency graph for
+// programming order and safe deletion, and can catch a dangling --jump
+// target at render time rather than waiting for iptables-restore to reject
+// it.
+type References struct {
+	// IPSetIDs maps each referenced ipset ID to the direction it was
+	// matched in.
+	IPSetIDs map[string]MatchDirection
+	// ChainNames is the set of chain names this chain jumps/goes to.
+	ChainNames map[string]bool
+	// MarkValues is the set of fwmark values this chain's actions set,
+	// e.g. via MARK --set-xmark.  Marks matched with -m mark --mark are not
+	// recorded.
+	MarkValues map[uint32]bool
+	// InterfaceNames is the set of interface names referenced by this
+	// chain's actions, e.g. a MASQUERADE/SNAT/DNAT out-interface.
+	InterfaceNames map[string]bool
+	// ConntrackZones is the set of conntrack zone IDs referenced by this
+	// chain's actions, e.g. via NOTRACK into a non-default zone.
+	ConntrackZones map[uint16]bool
+}
+
+// addIPSetID records that this chain matches on ipset id in direction,
+// merging with any direction already recorded for id rather than
+// overwriting it: an ipset matched as "src" in one rule and "dst" in
+// another is genuinely referenced in both directions, and a table manager
+// computing safe deletion order needs to see that, not just whichever
+// rule happened to be scanned last.
+func (refs *References) addIPSetID(id string, direction MatchDirection) {
+	existing, ok := refs.IPSetIDs[id]
+	if ok && existing != direction {
+		refs.IPSetIDs[id] = DirectionSourceDest
+		return
+	}
+	refs.IPSetIDs[id] = direction
+}
+
+func newReferences() References {
+	return References{
+		IPSetIDs:       map[string]MatchDirection{},
+		ChainNames:     map[string]bool{},
+		MarkValues:     map[uint32]bool{},
+		InterfaceNames: map[string]bool{},
+		ConntrackZones: map[uint16]bool{},
+	}
+}
+
+// ReferenceAdder is implemented by Action implementations that reference
+// other dataplane objects - jump targets, fwmarks, interfaces, conntrack
+// zones.  Chain.References calls it for every rule's Action so those
+// references are picked up without a type-switch over every concrete
+// Action.  Actions with nothing to contribute (ACCEPT, DROP, ...) don't
+// need to implement it.
+type ReferenceAdder interface {
+	AddReferences(refs *References)
+}
+
+// References returns everything this chain refers to: ipsets (with
+// src/dst direction), jump-target chain names, mark values, interface
+// names and conntrack zones.  ipset references are recovered by scanning
+// each rule's Match for "--match-set"; everything else comes from the
+// rule's Action, if it implements ReferenceAdder.
+func (c *Chain) References() References {
+	refs := newReferences()
+	if c == nil {
+		return refs
+	}
+	for _, rule := range c.Rules {
+		for _, matchString := range []string(rule.Match) {
+			words := strings.Split(matchString, " ")
+			for i := range words {
+				if words[i] != "--match-set" || i+1 >= len(words) {
+					continue
+				}
+				id := words[i+1]
+				direction := MatchDirection("")
+				if i+2 < len(words) {
+					direction = MatchDirection(words[i+2])
+				}
+				refs.addIPSetID(id, direction)
+			}
+		}
+		if ra, ok := rule.Action.(ReferenceAdder); ok {
+			ra.AddReferences(&refs)
+		}
+	}
+	return refs
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChainReferencesMergesIPSetDirections(t *testing.T) {
+	chain := &Chain{
+		Name: "c",
+		Rules: []Rule{
+			{Match: MatchCriteria{"-m set --match-set foo src"}, Action: AcceptAction{}},
+			{Match: MatchCriteria{"-m set --match-set foo dst"}, Action: AcceptAction{}},
+			{Match: MatchCriteria{"-m set --match-set bar dst"}, Action: AcceptAction{}},
+		},
+	}
+	refs := chain.References()
+	want := map[string]MatchDirection{
+		"foo": DirectionSourceDest,
+		"bar": DirectionDest,
+	}
+	if !reflect.DeepEqual(refs.IPSetIDs, want) {
+		t.Errorf("IPSetIDs = %#v, want %#v", refs.IPSetIDs, want)
+	}
+}
+
+func TestChainReferencesFromActions(t *testing.T) {
+	chain := &Chain{
+		Name: "c",
+		Rules: []Rule{
+			{Action: JumpAction{ChainName: "cali-FORWARD"}},
+			{Action: MarkAction{Mark: 0x1000, Mask: 0xf000}},
+			{Action: SNATAction{ToAddr: "10.0.0.1", OutInterface: "eth0"}},
+			{Action: CTZoneAction{Zone: 5}},
+			{Action: AcceptAction{}},
+		},
+	}
+	refs := chain.References()
+	if !refs.ChainNames["cali-FORWARD"] {
+		t.Errorf("ChainNames missing jump target: %#v", refs.ChainNames)
+	}
+	if !refs.MarkValues[0x1000] {
+		t.Errorf("MarkValues missing mark: %#v", refs.MarkValues)
+	}
+	if !refs.InterfaceNames["eth0"] {
+		t.Errorf("InterfaceNames missing interface: %#v", refs.InterfaceNames)
+	}
+	if !refs.ConntrackZones[5] {
+		t.Errorf("ConntrackZones missing zone: %#v", refs.ConntrackZones)
+	}
+}
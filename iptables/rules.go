@@ -22,6 +22,8 @@ import (
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/projectcalico/felix/generictables"
 )
 
 const (
@@ -111,6 +113,15 @@ type Chain struct {
 	Rules []Rule
 }
 
+// RuleHashes returns one hash per rule, used by the table manager to detect
+// which rules are already correctly programmed.  The hash input is each
+// rule's canonical (backend-independent) form where available, rather than
+// its rendered iptables-restore syntax, so that flipping Backend between
+// iptables and nftables (see the nftables package) doesn't, by itself,
+// churn every rule's hash from then on.  Note this change in hash input
+// does mean a one-time hash change for every rule on the release that
+// introduces it, the same as any other change to the hash input would
+// cause; it's only future Backend switches that this avoids.
 func (c *Chain) RuleHashes(features *Features) []string {
 	if c == nil {
 		return nil
@@ -140,7 +151,7 @@ func (c *Chain) RuleHashes(features *Features) []string {
 				"chain":    c.Name,
 			}).WithError(err).Panic("Failed to write suffix to hash.")
 		}
-		ruleForHashing := rule.RenderAppend(c.Name, "HASH", features)
+		ruleForHashing := canonicalHashInput(rule, features)
 		_, err = s.Write([]byte(ruleForHashing))
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -167,19 +178,13 @@ func (c *Chain) RuleHashes(features *Features) []string {
 	return hashes
 }
 
-func (c *Chain) IPSetIDs() (ipSetIDs []string) {
-	if c == nil {
-		return nil
-	}
-	for _, rule := range c.Rules {
-		for _, matchString := range []string(rule.Match) {
-			words := strings.Split(matchString, " ")
-			for i := range words {
-				if words[i] == "--match-set" && (i+1) < len(words) {
-					ipSetIDs = append(ipSetIDs, words[i+1])
-				}
-			}
-		}
+// canonicalHashInput builds the backend-stable hash input for a rule via
+// generictables.CanonicalRuleHashInput; see its doc for the fallback rules.
+func canonicalHashInput(rule Rule, features *Features) string {
+	ca, _ := rule.Action.(generictables.CanonicalAction)
+	renderedAction := ""
+	if ca == nil {
+		renderedAction = rule.Action.ToFragment(features)
 	}
-	return
+	return generictables.CanonicalRuleHashInput(rule.Comment, rule.Match, ca, renderedAction)
 }
@@ -0,0 +1,101 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import "fmt"
+
+// These mirror the small common action set in iptables/actions.go (accept,
+// drop, return, jump, mark, snat, ct-zone) one-for-one, with the same
+// CanonicalFragment strings, so that a rule using one of them hashes
+// identically - and actually has a renderer on both sides - whichever
+// Backend it's rendered for.
+
+// AcceptAction renders "accept".
+type AcceptAction struct{}
+
+func (a AcceptAction) ToFragment(features Features) string { return "accept" }
+
+func (a AcceptAction) CanonicalFragment() string { return "accept" }
+
+// DropAction renders "drop".
+type DropAction struct{}
+
+func (a DropAction) ToFragment(features Features) string { return "drop" }
+
+func (a DropAction) CanonicalFragment() string { return "drop" }
+
+// ReturnAction renders "return".
+type ReturnAction struct{}
+
+func (a ReturnAction) ToFragment(features Features) string { return "return" }
+
+func (a ReturnAction) CanonicalFragment() string { return "return" }
+
+// JumpAction renders "jump <ChainName>".
+type JumpAction struct {
+	ChainName string
+}
+
+func (a JumpAction) ToFragment(features Features) string { return "jump " + a.ChainName }
+
+func (a JumpAction) CanonicalFragment() string { return "jump:" + a.ChainName }
+
+// MarkAction renders a bitwise "meta mark set mark and <~Mask> xor
+// <Mark&Mask>", matching iptables' "-j MARK --set-xmark Mark/Mask": only the
+// bits selected by Mask are touched, and every other bit of the packet's
+// existing mark - set by an earlier rule or another feature sharing the
+// fwmark - is preserved.  A plain "meta mark set <value>" would instead
+// clobber the whole mark register, which is not the same rule.
+type MarkAction struct {
+	Mark uint32
+	Mask uint32
+}
+
+func (a MarkAction) ToFragment(features Features) string {
+	return fmt.Sprintf("meta mark set mark and 0x%x xor 0x%x", ^a.Mask, a.Mark&a.Mask)
+}
+
+func (a MarkAction) CanonicalFragment() string {
+	return fmt.Sprintf("mark:0x%x/0x%x", a.Mark, a.Mask)
+}
+
+// SNATAction renders "oifname "<OutInterface>" snat to <ToAddr>", the nft
+// equivalent of iptables' "-o <OutInterface> -j SNAT --to-source <ToAddr>".
+type SNATAction struct {
+	ToAddr       string
+	OutInterface string
+}
+
+func (a SNATAction) ToFragment(features Features) string {
+	return fmt.Sprintf("oifname %q snat to %s", a.OutInterface, a.ToAddr)
+}
+
+func (a SNATAction) CanonicalFragment() string {
+	return fmt.Sprintf("snat:%s:%s", a.OutInterface, a.ToAddr)
+}
+
+// CTZoneAction renders "ct zone set <Zone>", the nft equivalent of
+// iptables' "-j CT --zone <Zone>".
+type CTZoneAction struct {
+	Zone uint16
+}
+
+func (a CTZoneAction) ToFragment(features Features) string {
+	return fmt.Sprintf("ct zone set %d", a.Zone)
+}
+
+func (a CTZoneAction) CanonicalFragment() string {
+	return fmt.Sprintf("ctzone:%d", a.Zone)
+}
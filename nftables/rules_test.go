@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchCriteriaCanonical(t *testing.T) {
+	cases := []struct {
+		name  string
+		match MatchCriteria
+		want  []string
+	}{
+		// Same canonical token as iptables.MatchCriteria{"-m set --match-set foo src"} -
+		// see iptables.TestMatchCriteriaCanonical.
+		{name: "ipset src", match: MatchCriteria{"ip saddr @foo"}, want: []string{"ipset:src:foo"}},
+		{name: "ipset dst", match: MatchCriteria{"ip6 daddr @bar"}, want: []string{"ipset:dst:bar"}},
+		{name: "unrecognized fragment falls back to raw", match: MatchCriteria{"tcp dport 80"}, want: []string{"raw:tcp dport 80"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.match.Canonical()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Canonical() = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+// TestMarkActionToFragmentPreservesOtherBits guards against ToFragment going
+// back to a plain "meta mark set <value>", which would clobber every mark
+// bit outside Mask instead of only touching the bits the rule owns.
+func TestMarkActionToFragmentPreservesOtherBits(t *testing.T) {
+	a := MarkAction{Mark: 0x1000, Mask: 0xf000}
+	got := a.ToFragment(Features{})
+	want := "meta mark set mark and 0xffff0fff xor 0x1000"
+	if got != want {
+		t.Errorf("ToFragment() = %q, want %q", got, want)
+	}
+}
+
+func TestRuleRenderReplaceHandleOrdering(t *testing.T) {
+	r := Rule{
+		Match:   MatchCriteria{"ip saddr @foo"},
+		Action:  JumpAction{ChainName: "cali-FORWARD"},
+		Comment: []string{"c"},
+	}
+	got := r.RenderReplace("ip", "filter", "cali-INPUT", 7, Features{})
+	want := `replace rule ip filter cali-INPUT handle 7 ip saddr @foo jump cali-FORWARD comment "c"`
+	if got != want {
+		t.Errorf("RenderReplace() = %q, want %q", got, want)
+	}
+}